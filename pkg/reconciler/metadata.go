@@ -0,0 +1,48 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package reconciler holds the logic run by the Cluster controller in reaction to an update
+// of the Cluster CR, as opposed to the object-construction logic in pkg/specs
+package reconciler
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/simonmacklin/cloudnative-pg/pkg/utils"
+)
+
+// PatchObjectMetadata persists the updated annotations/labels of a single child object,
+// typically by issuing a Kubernetes patch request
+type PatchObjectMetadata func(object metav1.Object) error
+
+// ReconcileMetadata is called by the Cluster controller's Update handler whenever the
+// Cluster's own annotations or labels change. It cascades the inherited annotations/labels to
+// every object owned by the cluster and persists the ones that actually changed via patch,
+// so edits don't have to wait for each child's own next reconciliation
+func ReconcileMetadata(
+	cluster *metav1.ObjectMeta,
+	ownedObjects []metav1.Object,
+	controller utils.InheritanceController,
+	patch PatchObjectMetadata,
+) error {
+	for _, child := range utils.CascadeInheritedAnnotationsAndLabels(cluster, ownedObjects, controller) {
+		if err := patch(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
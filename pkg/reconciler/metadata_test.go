@@ -0,0 +1,73 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package reconciler
+
+import (
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type allowAllInheritanceController struct{}
+
+func (allowAllInheritanceController) IsAnnotationInherited(string) bool            { return true }
+func (allowAllInheritanceController) IsPodTemplateAnnotationInherited(string) bool { return true }
+func (allowAllInheritanceController) IsLabelInherited(string) bool                 { return true }
+
+func TestReconcileMetadataPatchesChangedChildren(t *testing.T) {
+	cluster := &metav1.ObjectMeta{
+		UID:         "cluster-uid",
+		Annotations: map[string]string{"team": "db"},
+	}
+	child := &metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{UID: "cluster-uid"}},
+	}
+
+	var patched []metav1.Object
+	err := ReconcileMetadata(cluster, []metav1.Object{child}, allowAllInheritanceController{},
+		func(object metav1.Object) error {
+			patched = append(patched, object)
+			return nil
+		})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(patched) != 1 {
+		t.Fatalf("expected exactly one child to be patched, got %d", len(patched))
+	}
+	if child.Annotations["team"] != "db" {
+		t.Errorf("expected the cluster's annotation to be cascaded, got %v", child.Annotations)
+	}
+}
+
+func TestReconcileMetadataStopsOnPatchError(t *testing.T) {
+	cluster := &metav1.ObjectMeta{
+		UID:         "cluster-uid",
+		Annotations: map[string]string{"team": "db"},
+	}
+	child := &metav1.ObjectMeta{
+		OwnerReferences: []metav1.OwnerReference{{UID: "cluster-uid"}},
+	}
+	boom := errors.New("boom")
+
+	err := ReconcileMetadata(cluster, []metav1.Object{child}, allowAllInheritanceController{},
+		func(metav1.Object) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Errorf("expected the patch error to be returned, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package specs builds the Kubernetes objects owned by a Cluster: Pods, PVCs, Services,
+// Secrets, PodDisruptionBudgets, Jobs and Backups
+package specs
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/simonmacklin/cloudnative-pg/pkg/utils"
+)
+
+// buildObjectMeta returns the ObjectMeta for a single object owned by the cluster, inheriting
+// the cluster's annotations and labels according to controller on top of the object's own
+// fixed name and labels
+func buildObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	name string,
+	fixedLabels map[string]string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       cluster.Namespace,
+		OwnerReferences: []metav1.OwnerReference{ownerRef},
+	}
+
+	utils.InheritLabels(&meta, cluster.Labels, fixedLabels, controller)
+	utils.InheritAnnotations(&meta, cluster.Annotations, nil, controller)
+
+	return meta
+}
+
+// PVCObjectMeta builds the ObjectMeta for a PVC of the given role, owned by the cluster
+func PVCObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	pvcName string,
+	role utils.PVCRole,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, pvcName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+		utils.PvcRoleLabelName: string(role),
+	}, controller)
+}
+
+// ServiceObjectMeta builds the ObjectMeta for a Service owned by the cluster
+func ServiceObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	serviceName string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, serviceName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+	}, controller)
+}
+
+// SecretObjectMeta builds the ObjectMeta for a Secret owned by the cluster
+func SecretObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	secretName string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, secretName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+	}, controller)
+}
+
+// PodDisruptionBudgetObjectMeta builds the ObjectMeta for a PodDisruptionBudget owned by the cluster
+func PodDisruptionBudgetObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	pdbName string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, pdbName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+	}, controller)
+}
+
+// JobObjectMeta builds the ObjectMeta for a Job of the given role, owned by the cluster
+func JobObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	jobName string,
+	role string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, jobName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+		utils.JobRoleLabelName: role,
+	}, controller)
+}
+
+// BackupObjectMeta builds the ObjectMeta for a Backup owned by the cluster
+func BackupObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	backupName string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, backupName, map[string]string{
+		utils.ClusterLabelName: cluster.Name,
+	}, controller)
+}
+
+// PodObjectMeta builds the ObjectMeta for an instance Pod owned by the cluster
+func PodObjectMeta(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	podName string,
+	controller utils.InheritanceController,
+) metav1.ObjectMeta {
+	return buildObjectMeta(cluster, ownerRef, podName, map[string]string{
+		utils.ClusterLabelName:      cluster.Name,
+		utils.PodRoleLabelName:      string(utils.PodRoleInstance),
+		utils.InstanceNameLabelName: podName,
+	}, controller)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specs
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/simonmacklin/cloudnative-pg/pkg/utils"
+)
+
+type allowAllInheritanceController struct{}
+
+func (allowAllInheritanceController) IsAnnotationInherited(string) bool            { return true }
+func (allowAllInheritanceController) IsPodTemplateAnnotationInherited(string) bool { return true }
+func (allowAllInheritanceController) IsLabelInherited(string) bool                 { return true }
+
+func TestPVCObjectMetaInheritsClusterMetadata(t *testing.T) {
+	cluster := &metav1.ObjectMeta{
+		Name:      "pg-cluster",
+		Namespace: "default",
+		UID:       "cluster-uid",
+		Labels:    map[string]string{"team": "db"},
+		Annotations: map[string]string{
+			"team":                              "db",
+			utils.ClusterManifestAnnotationName: "reserved-value",
+		},
+	}
+	ownerRef := metav1.OwnerReference{Name: cluster.Name, UID: cluster.UID}
+
+	meta := PVCObjectMeta(cluster, ownerRef, "pg-cluster-1", utils.PVCRolePgData, allowAllInheritanceController{})
+
+	if meta.Labels[utils.PvcRoleLabelName] != string(utils.PVCRolePgData) {
+		t.Errorf("expected pvc role label to be set, got %v", meta.Labels)
+	}
+	if meta.Labels["team"] != "db" {
+		t.Errorf("expected inherited cluster label to be copied, got %v", meta.Labels)
+	}
+	if meta.Annotations["team"] != "db" {
+		t.Errorf("expected inherited cluster annotation to be copied, got %v", meta.Annotations)
+	}
+	if _, ok := meta.Annotations[utils.ClusterManifestAnnotationName]; ok {
+		t.Errorf("expected reserved annotation not to be inherited, got %v", meta.Annotations)
+	}
+	if len(meta.OwnerReferences) != 1 || meta.OwnerReferences[0].UID != cluster.UID {
+		t.Errorf("expected owner reference to be set to the cluster, got %v", meta.OwnerReferences)
+	}
+}
@@ -0,0 +1,45 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specs
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/simonmacklin/cloudnative-pg/pkg/utils"
+)
+
+// NewInstancePod builds the Pod for a PostgreSQL instance owned by the cluster. Besides
+// inheriting the cluster's annotations/labels onto the Pod's own metadata, any
+// AppArmor/seccomp annotation found on the cluster is translated into the corresponding
+// SecurityContext field of podSpec, since PodSecurityPolicy is no longer available to do so
+func NewInstancePod(
+	cluster *metav1.ObjectMeta,
+	ownerRef metav1.OwnerReference,
+	podName string,
+	podSpec corev1.PodSpec,
+	controller utils.InheritanceController,
+) (*corev1.Pod, error) {
+	if err := utils.ApplySecurityProfiles(&podSpec, cluster.Annotations); err != nil {
+		return nil, err
+	}
+
+	return &corev1.Pod{
+		ObjectMeta: PodObjectMeta(cluster, ownerRef, podName, controller),
+		Spec:       podSpec,
+	}, nil
+}
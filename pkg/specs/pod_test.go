@@ -0,0 +1,69 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package specs
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/simonmacklin/cloudnative-pg/pkg/utils"
+)
+
+func TestNewInstancePodAppliesSecurityProfiles(t *testing.T) {
+	cluster := &metav1.ObjectMeta{
+		Name:      "pg-cluster",
+		Namespace: "default",
+		UID:       "cluster-uid",
+		Annotations: map[string]string{
+			utils.AppArmorAnnotationPrefix + "/postgres": "runtime/default",
+		},
+	}
+	ownerRef := metav1.OwnerReference{Name: cluster.Name, UID: cluster.UID}
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "postgres"}}}
+
+	pod, err := NewInstancePod(cluster, ownerRef, "pg-cluster-1", podSpec, allowAllInheritanceController{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	container := pod.Spec.Containers[0]
+	if container.SecurityContext == nil || container.SecurityContext.AppArmorProfile == nil {
+		t.Fatalf("expected AppArmor profile to be applied to the container, got %+v", container.SecurityContext)
+	}
+	if container.SecurityContext.AppArmorProfile.Type != corev1.AppArmorProfileTypeRuntimeDefault {
+		t.Errorf("expected runtime/default AppArmor profile, got %v", container.SecurityContext.AppArmorProfile.Type)
+	}
+}
+
+func TestNewInstancePodRejectsInvalidSecurityProfile(t *testing.T) {
+	cluster := &metav1.ObjectMeta{
+		Name:      "pg-cluster",
+		Namespace: "default",
+		UID:       "cluster-uid",
+		Annotations: map[string]string{
+			utils.AppArmorAnnotationPrefix + "/postgres": "not-a-valid-profile",
+		},
+	}
+	ownerRef := metav1.OwnerReference{Name: cluster.Name, UID: cluster.UID}
+	podSpec := corev1.PodSpec{Containers: []corev1.Container{{Name: "postgres"}}}
+
+	if _, err := NewInstancePod(cluster, ownerRef, "pg-cluster-1", podSpec, allowAllInheritanceController{}); err == nil {
+		t.Fatal("expected an error for an invalid AppArmor profile annotation")
+	}
+}
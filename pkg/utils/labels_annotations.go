@@ -17,11 +17,15 @@ limitations under the License.
 package utils
 
 import (
+	"fmt"
+	"path"
 	"reflect"
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // When you add a new label or annotation, please make sure that you also update the
@@ -53,6 +57,15 @@ const (
 	// This is required for Azure but can be set in other environments
 	AppArmorAnnotationPrefix = "container.apparmor.security.beta.kubernetes.io"
 
+	// SeccompAnnotationPrefix is the pod-wide seccomp profile annotation. It
+	// is expected to be used as `SeccompAnnotationPrefix + "/pod"`
+	SeccompAnnotationPrefix = "seccomp.security.alpha.kubernetes.io"
+
+	// ContainerSeccompAnnotationPrefix will be the name of the seccomp
+	// profile to apply to a specific container, following the same
+	// `prefix/containerName` convention as AppArmorAnnotationPrefix
+	ContainerSeccompAnnotationPrefix = "container.seccomp.security.alpha.kubernetes.io"
+
 	// ReconciliationLoopAnnotationName is the name of the annotation controlling
 	// the status of the reconciliation loop for the cluster
 	ReconciliationLoopAnnotationName = "cnpg.io/reconciliationLoop"
@@ -83,6 +96,11 @@ const (
 
 	// skipEmptyWalArchiveCheck turns off the checks that ensure that the WAL archive is empty before writing data
 	skipEmptyWalArchiveCheck = "cnpg.io/skipEmptyWalArchiveCheck"
+
+	// reservedAnnotationLabelPrefix is the prefix of the annotations and labels that are
+	// managed by the operator itself and can never be overwritten by inheritance, no matter
+	// what the configured allow-list says
+	reservedAnnotationLabelPrefix = "cnpg.io/"
 )
 
 type annotationStatus string
@@ -136,11 +154,48 @@ type InheritanceController interface {
 	// inherited
 	IsAnnotationInherited(name string) bool
 
+	// IsPodTemplateAnnotationInherited checks if a certain annotation should
+	// be inherited into the metadata of a PodSpec's template
+	IsPodTemplateAnnotationInherited(name string) bool
+
 	// IsLabelInherited checks if a certain label should be
 	// inherited
 	IsLabelInherited(name string) bool
 }
 
+// MatchesInheritancePattern checks if the given key matches one of the configured allow-list
+// patterns. A pattern is either an exact key (e.g. `owned-by`) or a glob understood by
+// path.Match (e.g. `example.com/*`, which like path.Match matches only a single path segment).
+// If a pattern ending in `/*` is not itself a valid glob, it is still honored as a plain prefix,
+// so the allow-list keeps working even for keys path.Match can't parse
+func MatchesInheritancePattern(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if pattern == key {
+			return true
+		}
+
+		matched, err := path.Match(pattern, key)
+		if err == nil {
+			if matched {
+				return true
+			}
+			continue
+		}
+
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(key, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsReservedAnnotationOrLabel returns true if the passed key belongs to the operator-reserved
+// `cnpg.io/*` namespace and must never be overwritten by inheritance
+func IsReservedAnnotationOrLabel(key string) bool {
+	return strings.HasPrefix(key, reservedAnnotationLabelPrefix)
+}
+
 // InheritAnnotations puts into the object metadata the passed annotations if
 // the annotations are supposed to be inherited. The passed configuration is
 // used to determine whenever a certain annotation is inherited or not
@@ -159,12 +214,45 @@ func InheritAnnotations(
 	}
 
 	for key, value := range annotations {
+		if IsReservedAnnotationOrLabel(key) {
+			continue
+		}
+
 		if controller.IsAnnotationInherited(key) {
 			object.Annotations[key] = value
 		}
 	}
 }
 
+// InheritPodTemplateAnnotations puts into a PodSpec template's metadata the
+// passed annotations if the annotations are supposed to be inherited into
+// the pod template. The passed configuration is used to determine whenever
+// a certain annotation is inherited or not
+func InheritPodTemplateAnnotations(
+	object *metav1.ObjectMeta,
+	annotations map[string]string,
+	fixedAnnotations map[string]string,
+	controller InheritanceController,
+) {
+	if object.Annotations == nil {
+		object.Annotations = make(map[string]string)
+	}
+
+	for key, value := range fixedAnnotations {
+		object.Annotations[key] = value
+	}
+
+	for key, value := range annotations {
+		if IsReservedAnnotationOrLabel(key) {
+			continue
+		}
+
+		if controller.IsPodTemplateAnnotationInherited(key) {
+			object.Annotations[key] = value
+		}
+	}
+}
+
 // InheritLabels puts into the object metadata the passed labels if
 // the labels are supposed to be inherited. The passed configuration is
 // used to determine whenever a certain label is inherited or not
@@ -183,38 +271,57 @@ func InheritLabels(
 	}
 
 	for key, value := range labels {
+		if IsReservedAnnotationOrLabel(key) {
+			continue
+		}
+
 		if controller.IsLabelInherited(key) {
 			object.Labels[key] = value
 		}
 	}
 }
 
-func getAnnotationAppArmor(spec *corev1.PodSpec, annotations map[string]string) map[string]string {
-	containsContainerWithName := func(name string, containers ...corev1.Container) bool {
-		for _, container := range containers {
-			if container.Name == name {
-				return true
-			}
+// containsContainerWithName returns true if one of the passed containers has the given name
+func containsContainerWithName(name string, containers ...corev1.Container) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
 		}
-
-		return false
 	}
 
-	appArmorAnnotations := make(map[string]string)
+	return false
+}
+
+// getContainerProfileAnnotations extracts, from the passed annotations, the ones whose key is
+// `prefix/containerName` and whose containerName matches one of the containers (or init
+// containers) in the given PodSpec. It is the common matching logic shared by every
+// per-container security-profile annotation (AppArmor, seccomp, ...)
+func getContainerProfileAnnotations(prefix string, spec *corev1.PodSpec, annotations map[string]string) map[string]string {
+	profileAnnotations := make(map[string]string)
 	for annotation, value := range annotations {
-		if strings.HasPrefix(annotation, AppArmorAnnotationPrefix) {
-			appArmorSplit := strings.SplitN(annotation, "/", 2)
-			if len(appArmorSplit) < 2 {
-				continue
-			}
+		if !strings.HasPrefix(annotation, prefix) {
+			continue
+		}
 
-			containerName := appArmorSplit[1]
-			if containsContainerWithName(containerName, append(spec.Containers, spec.InitContainers...)...) {
-				appArmorAnnotations[annotation] = value
-			}
+		annotationSplit := strings.SplitN(annotation, "/", 2)
+		if len(annotationSplit) < 2 {
+			continue
+		}
+
+		containerName := annotationSplit[1]
+		if containsContainerWithName(containerName, append(spec.Containers, spec.InitContainers...)...) {
+			profileAnnotations[annotation] = value
 		}
 	}
-	return appArmorAnnotations
+	return profileAnnotations
+}
+
+func getAnnotationAppArmor(spec *corev1.PodSpec, annotations map[string]string) map[string]string {
+	return getContainerProfileAnnotations(AppArmorAnnotationPrefix, spec, annotations)
+}
+
+func getAnnotationSeccomp(spec *corev1.PodSpec, annotations map[string]string) map[string]string {
+	return getContainerProfileAnnotations(ContainerSeccompAnnotationPrefix, spec, annotations)
 }
 
 // IsAnnotationAppArmorPresent checks if one of the annotations is an AppArmor annotation
@@ -245,6 +352,148 @@ func AnnotateAppArmor(object *metav1.ObjectMeta, spec *corev1.PodSpec, annotatio
 	}
 }
 
+// parseAppArmorProfile validates and converts an AppArmor annotation value (e.g.
+// "runtime/default", "localhost/my-profile", "unconfined") into the equivalent
+// corev1.AppArmorProfile
+func parseAppArmorProfile(value string) (*corev1.AppArmorProfile, error) {
+	switch {
+	case value == "unconfined":
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined}, nil
+	case value == "runtime/default":
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeRuntimeDefault}, nil
+	case strings.HasPrefix(value, "localhost/"):
+		localhostProfile := strings.TrimPrefix(value, "localhost/")
+		if localhostProfile == "" {
+			return nil, fmt.Errorf("invalid AppArmor profile %q: missing localhost profile name", value)
+		}
+		return &corev1.AppArmorProfile{
+			Type:             corev1.AppArmorProfileTypeLocalhost,
+			LocalhostProfile: &localhostProfile,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid AppArmor profile %q", value)
+	}
+}
+
+// parseSeccompProfile validates and converts a seccomp annotation value (e.g.
+// "runtime/default", "localhost/my-profile.json", "unconfined") into the equivalent
+// corev1.SeccompProfile
+func parseSeccompProfile(value string) (*corev1.SeccompProfile, error) {
+	switch {
+	case value == "unconfined":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}, nil
+	case value == "runtime/default", value == "docker/default":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, nil
+	case strings.HasPrefix(value, "localhost/"):
+		localhostProfile := strings.TrimPrefix(value, "localhost/")
+		if localhostProfile == "" {
+			return nil, fmt.Errorf("invalid seccomp profile %q: missing localhost profile path", value)
+		}
+		return &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: &localhostProfile,
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid seccomp profile %q", value)
+	}
+}
+
+// ApplySecurityProfiles translates the AppArmor and seccomp annotations found in the passed
+// annotations map into the equivalent SecurityContext.AppArmorProfile / SeccompProfile fields
+// on the PodSpec and its containers/initContainers. Per-container annotations take precedence
+// over the pod-wide seccomp default found in `SeccompAnnotationPrefix + "/pod"`. Every
+// annotation value is validated before anything is mutated, so on error spec is left untouched
+func ApplySecurityProfiles(spec *corev1.PodSpec, annotations map[string]string) error {
+	if spec == nil {
+		return nil
+	}
+
+	var podSeccompProfile *corev1.SeccompProfile
+	if value, ok := annotations[SeccompAnnotationPrefix+"/pod"]; ok {
+		profile, err := parseSeccompProfile(value)
+		if err != nil {
+			return err
+		}
+		podSeccompProfile = profile
+	}
+
+	appArmorAnnotations := getAnnotationAppArmor(spec, annotations)
+	seccompAnnotations := getAnnotationSeccomp(spec, annotations)
+
+	containerAppArmorProfiles := make(map[string]*corev1.AppArmorProfile, len(appArmorAnnotations))
+	containerSeccompProfiles := make(map[string]*corev1.SeccompProfile, len(seccompAnnotations))
+
+	planContainer := func(container *corev1.Container) error {
+		if value, ok := appArmorAnnotations[AppArmorAnnotationPrefix+"/"+container.Name]; ok {
+			profile, err := parseAppArmorProfile(value)
+			if err != nil {
+				return err
+			}
+			containerAppArmorProfiles[container.Name] = profile
+		}
+
+		if value, ok := seccompAnnotations[ContainerSeccompAnnotationPrefix+"/"+container.Name]; ok {
+			profile, err := parseSeccompProfile(value)
+			if err != nil {
+				return err
+			}
+			containerSeccompProfiles[container.Name] = profile
+		}
+
+		return nil
+	}
+
+	for i := range spec.Containers {
+		if err := planContainer(&spec.Containers[i]); err != nil {
+			return err
+		}
+	}
+	for i := range spec.InitContainers {
+		if err := planContainer(&spec.InitContainers[i]); err != nil {
+			return err
+		}
+	}
+
+	if podSeccompProfile != nil {
+		if spec.SecurityContext == nil {
+			spec.SecurityContext = &corev1.PodSecurityContext{}
+		}
+		spec.SecurityContext.SeccompProfile = podSeccompProfile
+	}
+
+	applyToContainer := func(container *corev1.Container) {
+		appArmorProfile, hasAppArmor := containerAppArmorProfiles[container.Name]
+		seccompProfile, hasSeccomp := containerSeccompProfiles[container.Name]
+		if !hasSeccomp {
+			seccompProfile = podSeccompProfile
+			hasSeccomp = podSeccompProfile != nil
+		}
+
+		if !hasAppArmor && !hasSeccomp {
+			return
+		}
+
+		if container.SecurityContext == nil {
+			container.SecurityContext = &corev1.SecurityContext{}
+		}
+		if hasAppArmor {
+			container.SecurityContext.AppArmorProfile = appArmorProfile
+		}
+		if hasSeccomp {
+			container.SecurityContext.SeccompProfile = seccompProfile
+		}
+	}
+
+	for i := range spec.Containers {
+		applyToContainer(&spec.Containers[i])
+	}
+	for i := range spec.InitContainers {
+		applyToContainer(&spec.InitContainers[i])
+	}
+
+	return nil
+}
+
 // IsReconciliationDisabled checks if the reconciliation loop is disabled on the given resource
 func IsReconciliationDisabled(object *metav1.ObjectMeta) bool {
 	return object.Annotations[ReconciliationLoopAnnotationName] == string(annotationStatusDisabled)
@@ -262,3 +511,135 @@ func MergeMap(receiver, giver map[string]string) {
 		receiver[key] = value
 	}
 }
+
+// MergeMapWithDeletion transfers the content of a giver map to a receiver, and additionally
+// removes from the receiver any key that matches one of the allow-list patterns but is no
+// longer present in the giver. isManaged decides, for a given key, whether its absence from
+// giver means it should be deleted from receiver; it is also the predicate that decided
+// whether the key was copied into giver in the first place, so there is a single source of
+// truth for which keys this merge is allowed to add or remove
+func MergeMapWithDeletion(receiver, giver map[string]string, isManaged func(key string) bool) {
+	MergeMap(receiver, giver)
+
+	for key := range receiver {
+		if _, stillPresent := giver[key]; stillPresent {
+			continue
+		}
+
+		if isManaged(key) {
+			delete(receiver, key)
+		}
+	}
+}
+
+// AnnotationDrift compares an existing map of annotations (or labels) against the desired one
+// and returns the keys that would be added, changed in value, or removed if existing were
+// brought in line with desired
+func AnnotationDrift(existing, desired map[string]string) (added, changed, removed []string) {
+	for key, desiredValue := range desired {
+		existingValue, ok := existing[key]
+		if !ok {
+			added = append(added, key)
+			continue
+		}
+
+		if existingValue != desiredValue {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range existing {
+		if _, ok := desired[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return added, changed, removed
+}
+
+// FindOwnedObjects returns the subset of children whose OwnerReferences point back to the
+// given parent UID
+func FindOwnedObjects(parentUID types.UID, children []metav1.Object) []metav1.Object {
+	var owned []metav1.Object
+
+	for _, child := range children {
+		for _, ref := range child.GetOwnerReferences() {
+			if ref.UID == parentUID {
+				owned = append(owned, child)
+				break
+			}
+		}
+	}
+
+	return owned
+}
+
+// CascadeInheritedAnnotationsAndLabels re-applies the parent's inherited annotations and labels
+// to every child object owned by it (as found by FindOwnedObjects), and un-sets on the children
+// any inheritable, non-reserved key that is not present on the parent, whether or not the child
+// got it from the parent in the first place. It is meant to be invoked on Cluster
+// update, so that annotation/label edits on the Cluster CR are cascaded to existing children
+// without waiting for each child's own full reconciliation. It returns the subset of children
+// whose annotations or labels actually changed, so callers only need to patch those
+func CascadeInheritedAnnotationsAndLabels(
+	parent *metav1.ObjectMeta,
+	children []metav1.Object,
+	controller InheritanceController,
+) []metav1.Object {
+	var changed []metav1.Object
+
+	isManagedAnnotation := func(key string) bool {
+		return !IsReservedAnnotationOrLabel(key) && controller.IsAnnotationInherited(key)
+	}
+	isManagedLabel := func(key string) bool {
+		return !IsReservedAnnotationOrLabel(key) && controller.IsLabelInherited(key)
+	}
+
+	for _, child := range FindOwnedObjects(parent.UID, children) {
+		existingAnnotations := child.GetAnnotations()
+		desiredAnnotations := make(map[string]string, len(existingAnnotations))
+		MergeMap(desiredAnnotations, existingAnnotations)
+		MergeMapWithDeletion(desiredAnnotations, filterInherited(parent.Annotations, controller.IsAnnotationInherited),
+			isManagedAnnotation)
+
+		existingLabels := child.GetLabels()
+		desiredLabels := make(map[string]string, len(existingLabels))
+		MergeMap(desiredLabels, existingLabels)
+		MergeMapWithDeletion(desiredLabels, filterInherited(parent.Labels, controller.IsLabelInherited), isManagedLabel)
+
+		addedA, changedA, removedA := AnnotationDrift(existingAnnotations, desiredAnnotations)
+		addedL, changedL, removedL := AnnotationDrift(existingLabels, desiredLabels)
+
+		if len(addedA)+len(changedA)+len(removedA)+len(addedL)+len(changedL)+len(removedL) == 0 {
+			continue
+		}
+
+		child.SetAnnotations(desiredAnnotations)
+		child.SetLabels(desiredLabels)
+		changed = append(changed, child)
+	}
+
+	return changed
+}
+
+// filterInherited returns the subset of the passed map whose keys are both inheritable
+// (according to isInherited) and not reserved for operator use
+func filterInherited(source map[string]string, isInherited func(string) bool) map[string]string {
+	filtered := make(map[string]string, len(source))
+
+	for key, value := range source {
+		if IsReservedAnnotationOrLabel(key) {
+			continue
+		}
+
+		if isInherited(key) {
+			filtered[key] = value
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,410 @@
+/*
+Copyright The CloudNativePG Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMatchesInheritancePattern(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		key      string
+		want     bool
+	}{
+		{"exact match", []string{"owned-by"}, "owned-by", true},
+		{"exact mismatch", []string{"owned-by"}, "owned-by-someone-else", false},
+		{"glob match", []string{"example.com/*"}, "example.com/team", true},
+		{"glob mismatch other domain", []string{"example.com/*"}, "other.com/team", false},
+		{"glob does not cross path segments", []string{"example.com/*"}, "example.com/a/b", false},
+		{"malformed glob still matches as prefix", []string{"example.com/ann[otation/*"}, "example.com/ann[otation/team", true},
+		{"malformed glob does not match unrelated key", []string{"example.com/ann[otation/*"}, "example.com/other", false},
+		{"no patterns", nil, "example.com/team", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := MatchesInheritancePattern(c.patterns, c.key); got != c.want {
+				t.Errorf("MatchesInheritancePattern(%v, %q) = %v, want %v", c.patterns, c.key, got, c.want)
+			}
+		})
+	}
+}
+
+func TestIsReservedAnnotationOrLabel(t *testing.T) {
+	cases := []struct {
+		key  string
+		want bool
+	}{
+		{"cnpg.io/cluster", true},
+		{"cnpg.io/anything", true},
+		{"example.com/cnpg.io", false},
+		{"owned-by", false},
+	}
+
+	for _, c := range cases {
+		if got := IsReservedAnnotationOrLabel(c.key); got != c.want {
+			t.Errorf("IsReservedAnnotationOrLabel(%q) = %v, want %v", c.key, got, c.want)
+		}
+	}
+}
+
+type allowAllInheritanceController struct{}
+
+func (allowAllInheritanceController) IsAnnotationInherited(string) bool            { return true }
+func (allowAllInheritanceController) IsPodTemplateAnnotationInherited(string) bool { return true }
+func (allowAllInheritanceController) IsLabelInherited(string) bool                 { return true }
+
+func TestInheritAnnotationsSkipsReservedKeys(t *testing.T) {
+	object := &metav1.ObjectMeta{}
+	InheritAnnotations(object, map[string]string{
+		"cnpg.io/cluster": "attacker-controlled",
+		"owned-by":        "team-a",
+	}, nil, allowAllInheritanceController{})
+
+	if _, ok := object.Annotations["cnpg.io/cluster"]; ok {
+		t.Errorf("expected reserved annotation to be skipped, got %v", object.Annotations)
+	}
+	if object.Annotations["owned-by"] != "team-a" {
+		t.Errorf("expected non-reserved annotation to be inherited, got %v", object.Annotations)
+	}
+}
+
+// podTemplateExcludingController inherits every annotation onto the enclosing object, but
+// excludes churnyAnnotation from the pod template
+type podTemplateExcludingController struct {
+	churnyAnnotation string
+}
+
+func (c podTemplateExcludingController) IsAnnotationInherited(string) bool { return true }
+
+func (c podTemplateExcludingController) IsPodTemplateAnnotationInherited(name string) bool {
+	return name != c.churnyAnnotation
+}
+
+func (c podTemplateExcludingController) IsLabelInherited(string) bool { return true }
+
+func TestInheritPodTemplateAnnotationsExcludesChurnyKeys(t *testing.T) {
+	controller := podTemplateExcludingController{churnyAnnotation: "gitops.example.com/last-applied"}
+	source := map[string]string{
+		"gitops.example.com/last-applied": "abc123",
+		"owned-by":                        "team-a",
+	}
+
+	object := &metav1.ObjectMeta{}
+	InheritAnnotations(object, source, nil, controller)
+	if object.Annotations["gitops.example.com/last-applied"] != "abc123" {
+		t.Errorf("expected object-level annotation to be inherited, got %v", object.Annotations)
+	}
+
+	podTemplate := &metav1.ObjectMeta{}
+	InheritPodTemplateAnnotations(podTemplate, source, nil, controller)
+	if _, ok := podTemplate.Annotations["gitops.example.com/last-applied"]; ok {
+		t.Errorf("expected churny annotation to be excluded from the pod template, got %v", podTemplate.Annotations)
+	}
+	if podTemplate.Annotations["owned-by"] != "team-a" {
+		t.Errorf("expected non-churny annotation to be inherited into the pod template, got %v", podTemplate.Annotations)
+	}
+}
+
+func TestInheritLabelsSkipsReservedKeys(t *testing.T) {
+	object := &metav1.ObjectMeta{}
+	InheritLabels(object, map[string]string{
+		"cnpg.io/cluster": "attacker-controlled",
+		"owned-by":        "team-a",
+	}, nil, allowAllInheritanceController{})
+
+	if _, ok := object.Labels["cnpg.io/cluster"]; ok {
+		t.Errorf("expected reserved label to be skipped, got %v", object.Labels)
+	}
+	if object.Labels["owned-by"] != "team-a" {
+		t.Errorf("expected non-reserved label to be inherited, got %v", object.Labels)
+	}
+}
+
+func TestParseAppArmorProfile(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    *corev1.AppArmorProfile
+		wantErr bool
+	}{
+		{"unconfined", &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined}, false},
+		{"runtime/default", &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeRuntimeDefault}, false},
+		{"localhost/my-profile", &corev1.AppArmorProfile{
+			Type:             corev1.AppArmorProfileTypeLocalhost,
+			LocalhostProfile: ptrTo("my-profile"),
+		}, false},
+		{"localhost/", nil, true},
+		{"not-a-real-profile", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := parseAppArmorProfile(c.value)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseAppArmorProfile(%q): expected error, got none", c.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAppArmorProfile(%q): unexpected error: %v", c.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseAppArmorProfile(%q) = %+v, want %+v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestParseSeccompProfile(t *testing.T) {
+	cases := []struct {
+		value   string
+		want    *corev1.SeccompProfile
+		wantErr bool
+	}{
+		{"unconfined", &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}, false},
+		{"runtime/default", &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, false},
+		{"docker/default", &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, false},
+		{"localhost/my-profile.json", &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: ptrTo("my-profile.json"),
+		}, false},
+		{"localhost/", nil, true},
+		{"not-a-real-profile", nil, true},
+	}
+
+	for _, c := range cases {
+		got, err := parseSeccompProfile(c.value)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseSeccompProfile(%q): expected error, got none", c.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSeccompProfile(%q): unexpected error: %v", c.value, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseSeccompProfile(%q) = %+v, want %+v", c.value, got, c.want)
+		}
+	}
+}
+
+func TestApplySecurityProfiles(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "postgres"},
+			{Name: "exporter"},
+		},
+	}
+	annotations := map[string]string{
+		SeccompAnnotationPrefix + "/pod":               "runtime/default",
+		AppArmorAnnotationPrefix + "/postgres":         "localhost/postgres-profile",
+		ContainerSeccompAnnotationPrefix + "/exporter": "unconfined",
+	}
+
+	if err := ApplySecurityProfiles(spec, annotations); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	postgres := spec.Containers[0]
+	if postgres.SecurityContext == nil || postgres.SecurityContext.AppArmorProfile == nil {
+		t.Fatalf("expected postgres container to have an AppArmor profile set")
+	}
+	if postgres.SecurityContext.AppArmorProfile.Type != corev1.AppArmorProfileTypeLocalhost {
+		t.Errorf("expected localhost AppArmor profile, got %v", postgres.SecurityContext.AppArmorProfile.Type)
+	}
+	if postgres.SecurityContext.SeccompProfile == nil ||
+		postgres.SecurityContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("expected postgres container to inherit the pod-wide seccomp default, got %+v",
+			postgres.SecurityContext.SeccompProfile)
+	}
+
+	exporter := spec.Containers[1]
+	if exporter.SecurityContext == nil || exporter.SecurityContext.SeccompProfile == nil ||
+		exporter.SecurityContext.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+		t.Errorf("expected exporter container's explicit seccomp annotation to win over the pod default, got %+v",
+			exporter.SecurityContext)
+	}
+}
+
+func TestApplySecurityProfilesLeavesSpecUntouchedOnError(t *testing.T) {
+	spec := &corev1.PodSpec{
+		Containers: []corev1.Container{
+			{Name: "postgres"},
+			{Name: "broken"},
+		},
+	}
+	annotations := map[string]string{
+		SeccompAnnotationPrefix + "/pod":             "runtime/default",
+		AppArmorAnnotationPrefix + "/postgres":       "runtime/default",
+		ContainerSeccompAnnotationPrefix + "/broken": "not-a-real-profile",
+	}
+
+	before := spec.DeepCopy()
+
+	if err := ApplySecurityProfiles(spec, annotations); err == nil {
+		t.Fatalf("expected an error due to the malformed seccomp profile on the broken container")
+	}
+
+	if !reflect.DeepEqual(spec, before) {
+		t.Errorf("expected spec to be left untouched when ApplySecurityProfiles fails, got %+v, want %+v", spec, before)
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
+
+func TestMergeMapWithDeletion(t *testing.T) {
+	isManaged := func(key string) bool { return key == "owned-by" || key == "cost-center" }
+
+	receiver := map[string]string{
+		"owned-by":      "team-a",
+		"cost-center":   "1234",
+		"user-supplied": "keep-me",
+	}
+	giver := map[string]string{
+		"owned-by": "team-b",
+	}
+
+	MergeMapWithDeletion(receiver, giver, isManaged)
+
+	want := map[string]string{
+		"owned-by":      "team-b",
+		"user-supplied": "keep-me",
+	}
+	if !reflect.DeepEqual(receiver, want) {
+		t.Errorf("MergeMapWithDeletion() = %v, want %v", receiver, want)
+	}
+}
+
+func TestAnnotationDrift(t *testing.T) {
+	existing := map[string]string{"a": "1", "b": "2", "c": "3"}
+	desired := map[string]string{"a": "1", "b": "changed", "d": "4"}
+
+	added, changed, removed := AnnotationDrift(existing, desired)
+
+	if !reflect.DeepEqual(added, []string{"d"}) {
+		t.Errorf("added = %v, want [d]", added)
+	}
+	if !reflect.DeepEqual(changed, []string{"b"}) {
+		t.Errorf("changed = %v, want [b]", changed)
+	}
+	if !reflect.DeepEqual(removed, []string{"c"}) {
+		t.Errorf("removed = %v, want [c]", removed)
+	}
+}
+
+func TestFindOwnedObjects(t *testing.T) {
+	parentUID := types.UID("parent-uid")
+	owned := &metav1.ObjectMeta{
+		Name:            "owned",
+		OwnerReferences: []metav1.OwnerReference{{UID: parentUID}},
+	}
+	notOwned := &metav1.ObjectMeta{
+		Name:            "not-owned",
+		OwnerReferences: []metav1.OwnerReference{{UID: "someone-else"}},
+	}
+
+	result := FindOwnedObjects(parentUID, []metav1.Object{owned, notOwned})
+
+	if len(result) != 1 || result[0].GetName() != "owned" {
+		t.Errorf("FindOwnedObjects() = %v, want only %q", result, "owned")
+	}
+}
+
+// cascadeTestController inherits every non-reserved annotation/label whose key is in allowed
+type cascadeTestController struct {
+	allowed map[string]bool
+}
+
+func (c cascadeTestController) IsAnnotationInherited(name string) bool { return c.allowed[name] }
+func (c cascadeTestController) IsPodTemplateAnnotationInherited(name string) bool {
+	return c.allowed[name]
+}
+func (c cascadeTestController) IsLabelInherited(name string) bool { return c.allowed[name] }
+
+func TestCascadeInheritedAnnotationsAndLabels(t *testing.T) {
+	parentUID := types.UID("cluster-uid")
+	controller := cascadeTestController{allowed: map[string]bool{"owned-by": true}}
+
+	parent := &metav1.ObjectMeta{
+		UID: parentUID,
+		Annotations: map[string]string{
+			"owned-by":       "team-b",
+			"cnpg.io/ignore": "should-never-propagate",
+		},
+	}
+
+	child := &metav1.ObjectMeta{
+		Name:            "pod-1",
+		OwnerReferences: []metav1.OwnerReference{{UID: parentUID}},
+		Annotations: map[string]string{
+			"owned-by":  "team-a", // stale value, should be updated
+			"unmanaged": "untouched",
+		},
+	}
+	unrelated := &metav1.ObjectMeta{
+		Name:            "pod-2",
+		OwnerReferences: []metav1.OwnerReference{{UID: "someone-else"}},
+	}
+
+	changed := CascadeInheritedAnnotationsAndLabels(parent, []metav1.Object{child, unrelated}, controller)
+
+	if len(changed) != 1 || changed[0].GetName() != "pod-1" {
+		t.Fatalf("expected only pod-1 to change, got %v", changed)
+	}
+	if child.Annotations["owned-by"] != "team-b" {
+		t.Errorf("expected owned-by to be updated to the parent's value, got %v", child.Annotations)
+	}
+	if child.Annotations["unmanaged"] != "untouched" {
+		t.Errorf("expected unmanaged annotation to be left alone, got %v", child.Annotations)
+	}
+	if _, ok := child.Annotations["cnpg.io/ignore"]; ok {
+		t.Errorf("expected reserved annotation to never be cascaded, got %v", child.Annotations)
+	}
+}
+
+func TestCascadeInheritedAnnotationsAndLabelsUnsetsRemovedKeys(t *testing.T) {
+	parentUID := types.UID("cluster-uid")
+	// "owned-by" stays inheritable under policy; the Cluster CR itself no longer carries it
+	controller := cascadeTestController{allowed: map[string]bool{"owned-by": true}}
+
+	parent := &metav1.ObjectMeta{UID: parentUID}
+	child := &metav1.ObjectMeta{
+		Name:            "pod-1",
+		OwnerReferences: []metav1.OwnerReference{{UID: parentUID}},
+		Annotations:     map[string]string{"owned-by": "team-a"},
+	}
+
+	changed := CascadeInheritedAnnotationsAndLabels(parent, []metav1.Object{child}, controller)
+
+	if len(changed) != 1 {
+		t.Fatalf("expected pod-1 to change, got %v", changed)
+	}
+	if _, ok := child.Annotations["owned-by"]; ok {
+		t.Errorf("expected owned-by to be un-set once removed from the parent, got %v", child.Annotations)
+	}
+}